@@ -1,195 +1,1074 @@
-package main
-
-import (
-	"archive/zip"
-	"fmt"
-	"log"
-	"os"
-	"path/filepath"
-	"sort"
-	"strings"
-	"time"
-)
-
-type FileRecord struct {
-	Name        string
-	ModTime     time.Time
-	ArchivePath string
-	ArchiveName string
-	Size        int64
-}
-
-// findArchiveFiles находит все файлы архивов в указанной директории
-func findArchiveFiles(dir string) ([]string, error) {
-	var archives []string
-
-	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		if !info.IsDir() && isArchiveFile(path) {
-			archives = append(archives, path)
-		}
-
-		return nil
-	})
-
-	if err != nil {
-		return nil, err
-	}
-
-	return archives, nil
-}
-
-// isArchiveFile проверяет, является ли файл архивом (по расширению)
-func isArchiveFile(filename string) bool {
-	ext := strings.ToLower(filepath.Ext(filename))
-	return ext == ".zip" // Можно добавить другие форматы: .rar, .7z и т.д.
-}
-
-// extractFileInfoFromArchive извлекает информацию о файлах из архива
-func extractFileInfoFromArchive(archivePath string) ([]FileRecord, error) {
-	var files []FileRecord
-
-	// Получаем дату модификации самого архива
-	archiveInfo, err := os.Stat(archivePath)
-	if err != nil {
-		return nil, err
-	}
-
-	r, err := zip.OpenReader(archivePath)
-	if err != nil {
-		return nil, err
-	}
-	defer r.Close()
-
-	for _, f := range r.File {
-		// Пропускаем директории
-		if f.FileInfo().IsDir() {
-			continue
-		}
-
-		files = append(files, FileRecord{
-			Name:        f.Name,
-			ModTime:     archiveInfo.ModTime(), // Используем дату архива
-			ArchivePath: archivePath,
-			ArchiveName: filepath.Base(archivePath),
-			Size:        f.FileInfo().Size(),
-		})
-	}
-
-	return files, nil
-}
-
-// determineLatestReleases определяет последние релизы файлов
-func determineLatestReleases(allFiles map[string][]FileRecord) map[string]FileRecord {
-	latest := make(map[string]FileRecord)
-
-	for filename, versions := range allFiles {
-		if len(versions) == 0 {
-			continue
-		}
-
-		// Сортируем версии по дате (от старых к новым)
-		sort.Slice(versions, func(i, j int) bool {
-			return versions[i].ModTime.Before(versions[j].ModTime)
-		})
-
-		// Берем последнюю версию (самую новую)
-		latest[filename] = versions[len(versions)-1]
-	}
-
-	return latest
-}
-
-// writeResultsToFile записывает результаты в текстовый файл
-func writeResultsToFile(filename string, results map[string]FileRecord) error {
-	file, err := os.Create(filename)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	// Записываем заголовок
-	header := fmt.Sprintf("%-50s %-20s %-10s %s\n", "Файл", "Дата релиза", "Размер", "Архив")
-	divider := strings.Repeat("-", len(header)) + "\n"
-
-	if _, err := file.WriteString(header); err != nil {
-		return err
-	}
-	if _, err := file.WriteString(divider); err != nil {
-		return err
-	}
-
-	// Записываем данные
-	for _, record := range results {
-
-		line := fmt.Sprintf("%-50s %-20s %-10d %s\n",
-			truncateString(record.Name, 50),
-			record.ModTime.Format("2006-01-02 15:04:05"),
-			record.Size,
-			record.ArchiveName)
-
-		if _, err := file.WriteString(line); err != nil {
-			return err
-		}
-	}
-
-	return nil
-}
-
-// truncateString обрезает строку до указанной длины
-func truncateString(s string, maxLen int) string {
-	if len(s) <= maxLen {
-		return s
-	}
-	return s[:maxLen-3] + "..."
-}
-
-func main() {
-	// Конфигурационные параметры
-	archiveDir := "X:/NETDBS"             // Директория с архивами
-	outputFile := "./latest_releases.txt" // Файл для записи результатов
-
-	fmt.Printf("Поиск архивов в директории: %s\n", archiveDir)
-
-	// Получаем список всех архивов
-	archives, err := findArchiveFiles(archiveDir)
-	if err != nil {
-		log.Fatalf("Ошибка поиска архивов: %v", err)
-	}
-
-	if len(archives) == 0 {
-		log.Fatal("Архивы не найдены")
-	}
-
-	fmt.Printf("Найдено архивов: %d\n", len(archives))
-
-	// Собираем информацию о всех файлах во всех архивах
-	allFiles := make(map[string][]FileRecord)
-
-	for _, archivePath := range archives {
-		files, err := extractFileInfoFromArchive(archivePath)
-		if err != nil {
-			log.Printf("Ошибка обработки архива %s: %v", archivePath, err)
-			continue
-		}
-
-		for _, file := range files {
-			allFiles[file.Name] = append(allFiles[file.Name], file)
-		}
-	}
-
-	// Определяем последние релизы файлов
-	latestReleases := determineLatestReleases(allFiles)
-
-	// Сохраняем результаты в файл
-	err = writeResultsToFile(outputFile, latestReleases)
-	if err != nil {
-		log.Fatalf("Ошибка записи результатов: %v", err)
-	}
-
-	fmt.Printf("Результаты сохранены в файл: %s\n", outputFile)
-	fmt.Printf("Обработано уникальных файлов: %d\n", len(latestReleases))
-}
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bodgit/sevenzip"
+	"github.com/ulikunitz/xz"
+
+	"github.com/FernandoAlonso1/launch_last_releases/retention"
+	"github.com/FernandoAlonso1/launch_last_releases/version"
+)
+
+type FileRecord struct {
+	Name        string
+	ModTime     time.Time
+	ArchivePath string
+	ArchiveName string
+	Size        int64
+	Version     string // каноническая версия, разобранная version.ParseVersion; "" если не распознана
+	Checksum    string // SHA-256 содержимого записи в hex-виде, посчитанный потоково во время извлечения
+}
+
+// releaseStrategy выбирает способ определения "последнего" релиза среди
+// нескольких копий одного файла:
+//   - mtime   — по дате модификации (как было изначально);
+//   - semver  — по разобранной версии из имени файла/архива;
+//   - hybrid  — по версии, а при равенстве версий — по дате модификации.
+var releaseStrategy = flag.String("strategy", "mtime", "стратегия выбора последнего релиза: mtime, semver или hybrid")
+
+// Флаги формата отчёта. outputFormat выбирает реализацию Sink; elasticURL,
+// elasticIndex и elasticMapping используются только форматом "elastic".
+var (
+	outputFormat   = flag.String("format", "text", "формат отчёта: text, json, csv или elastic")
+	elasticURL     = flag.String("elastic-url", "", "адрес Elasticsearch для формата elastic, например http://localhost:9200")
+	elasticIndex   = flag.String("elastic-index", "latest_releases", "имя индекса Elasticsearch для формата elastic")
+	elasticMapping = flag.String("elastic-mapping", "", "путь к JSON-файлу с маппингом индекса для формата elastic; индекс создаётся с этим маппингом, если ещё не существует")
+)
+
+// Флаги режима -prune.
+var (
+	pruneMode  = flag.Bool("prune", false, "вместо построения отчёта применить ступенчатую политику хранения к копиям, не являющимся последним релизом")
+	applyPrune = flag.Bool("apply", false, "вместе с -prune действительно удалять архивы, а не только показывать, что было бы удалено")
+)
+
+// Флаги параллельного сканирования.
+var (
+	scanJobs       = flag.Int("jobs", runtime.NumCPU(), "число параллельных воркеров для сканирования архивов")
+	archiveTimeout = flag.Duration("timeout", 2*time.Minute, "максимальное время обработки одного архива (0 — без ограничения)")
+)
+
+// ArchiveReader извлекает информацию о файлах из архива определённого формата.
+// Новые форматы добавляются реализацией этого интерфейса и регистрацией
+// через registerArchiveReader, без изменения логики обхода каталогов.
+type ArchiveReader interface {
+	Extract(archivePath string) ([]FileRecord, error)
+}
+
+// archiveReaders сопоставляет расширение файла (в нижнем регистре, с точкой)
+// с обработчиком соответствующего формата архива.
+var archiveReaders = map[string]ArchiveReader{}
+
+// registerArchiveReader регистрирует обработчик для указанного расширения.
+func registerArchiveReader(ext string, reader ArchiveReader) {
+	archiveReaders[ext] = reader
+}
+
+func init() {
+	registerArchiveReader(".zip", zipArchiveReader{})
+
+	tarReader := tarArchiveReader{}
+	registerArchiveReader(".tar", tarReader)
+	registerArchiveReader(".tar.gz", tarReader)
+	registerArchiveReader(".tgz", tarReader)
+	registerArchiveReader(".tar.bz2", tarReader)
+	registerArchiveReader(".tbz2", tarReader)
+	registerArchiveReader(".tar.xz", tarReader)
+	registerArchiveReader(".txz", tarReader)
+
+	registerArchiveReader(".7z", sevenZipArchiveReader{})
+}
+
+// archiveExt возвращает зарегистрированное расширение архива для переданного
+// пути (с учётом составных расширений вида ".tar.gz") или пустую строку,
+// если файл не распознан как архив.
+func archiveExt(filename string) string {
+	lower := strings.ToLower(filename)
+
+	// Составные расширения проверяем раньше простых, чтобы "archive.tar.gz"
+	// не был ошибочно распознан по ".gz".
+	for ext := range archiveReaders {
+		if strings.Count(ext, ".") > 1 && strings.HasSuffix(lower, ext) {
+			return ext
+		}
+	}
+
+	ext := filepath.Ext(lower)
+	if _, ok := archiveReaders[ext]; ok {
+		return ext
+	}
+
+	return ""
+}
+
+// findArchiveFiles находит все файлы архивов в указанной директории
+func findArchiveFiles(dir string) ([]string, error) {
+	var archives []string
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() && isArchiveFile(path) {
+			archives = append(archives, path)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return archives, nil
+}
+
+// isArchiveFile проверяет, является ли файл архивом поддерживаемого формата
+// (zip, tar, tar.gz, tar.bz2, tar.xz, 7z).
+func isArchiveFile(filename string) bool {
+	return archiveExt(filename) != ""
+}
+
+// extractFileInfoFromArchive извлекает информацию о файлах из архива,
+// делегируя разбор зарегистрированному для его расширения ArchiveReader.
+func extractFileInfoFromArchive(archivePath string) ([]FileRecord, error) {
+	ext := archiveExt(archivePath)
+
+	reader, ok := archiveReaders[ext]
+	if !ok {
+		return nil, fmt.Errorf("неподдерживаемый формат архива: %s", archivePath)
+	}
+
+	return reader.Extract(archivePath)
+}
+
+// ScanOptions настраивает Scan.
+type ScanOptions struct {
+	// Jobs — число воркеров, параллельно обрабатывающих архивы. <= 0
+	// означает runtime.NumCPU().
+	Jobs int
+	// ArchiveTimeout ограничивает время обработки одного архива. <= 0
+	// означает "без ограничения".
+	ArchiveTimeout time.Duration
+	// Progress, если задан, вызывается после обработки каждого архива.
+	Progress func(ScanProgress)
+}
+
+// ScanProgress описывает состояние сканирования сразу после обработки
+// одного архива; используется для прогресс-бара и не гарантирует порядок
+// между вызовами из разных воркеров.
+type ScanProgress struct {
+	ArchivePath   string
+	ArchivesDone  int
+	ArchivesTotal int
+	BytesDone     int64
+	BytesTotal    int64
+	Duration      time.Duration
+	Err           error
+}
+
+// ArchiveError описывает ошибку обработки конкретного архива.
+type ArchiveError struct {
+	ArchivePath string
+	Err         error
+}
+
+func (e *ArchiveError) Error() string {
+	return fmt.Sprintf("%s: %v", e.ArchivePath, e.Err)
+}
+
+// ScanReport — результат Scan: файлы, сгруппированные по имени, ошибки по
+// отдельным архивам и время обработки каждого архива.
+type ScanReport struct {
+	Files   map[string][]FileRecord
+	Errors  []ArchiveError
+	Timings map[string]time.Duration
+}
+
+// Scan находит в dir все поддерживаемые архивы и извлекает из них информацию
+// о файлах, используя пул из opts.Jobs воркеров (по умолчанию
+// runtime.NumCPU()). Обработка каждого архива ограничена
+// opts.ArchiveTimeout, чтобы один повреждённый или зависший архив не
+// останавливал весь обход; такой архив попадает в ScanReport.Errors.
+// Вынесена из main в отдельную функцию, чтобы логику сканирования можно было
+// тестировать без запуска всей программы.
+func Scan(dir string, opts ScanOptions) (*ScanReport, error) {
+	archivePaths, err := findArchiveFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var bytesTotal int64
+	for _, p := range archivePaths {
+		if info, err := os.Stat(p); err == nil {
+			bytesTotal += info.Size()
+		}
+	}
+
+	jobs := opts.Jobs
+	if jobs <= 0 {
+		jobs = runtime.NumCPU()
+	}
+
+	report := &ScanReport{
+		Files:   make(map[string][]FileRecord),
+		Timings: make(map[string]time.Duration),
+	}
+
+	var (
+		mu        sync.Mutex
+		bytesDone int64
+		done      int32
+		paths     = make(chan string)
+		wg        sync.WaitGroup
+	)
+
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for path := range paths {
+				files, scanErr, duration := extractFileInfoWithTimeout(path, opts.ArchiveTimeout)
+
+				var size int64
+				if info, statErr := os.Stat(path); statErr == nil {
+					size = info.Size()
+				}
+
+				mu.Lock()
+				report.Timings[path] = duration
+				if scanErr != nil {
+					report.Errors = append(report.Errors, ArchiveError{ArchivePath: path, Err: scanErr})
+				} else {
+					for _, f := range files {
+						report.Files[f.Name] = append(report.Files[f.Name], f)
+					}
+				}
+				bytesDone += size
+				progress := ScanProgress{
+					ArchivePath:   path,
+					ArchivesDone:  int(atomic.AddInt32(&done, 1)),
+					ArchivesTotal: len(archivePaths),
+					BytesDone:     bytesDone,
+					BytesTotal:    bytesTotal,
+					Duration:      duration,
+					Err:           scanErr,
+				}
+				mu.Unlock()
+
+				if opts.Progress != nil {
+					opts.Progress(progress)
+				}
+			}
+		}()
+	}
+
+	for _, p := range archivePaths {
+		paths <- p
+	}
+	close(paths)
+
+	wg.Wait()
+
+	return report, nil
+}
+
+// extractFileInfoWithTimeout вызывает extractFileInfoFromArchive, прерывая
+// ожидание по истечении timeout (<= 0 — без ограничения). При таймауте
+// горутина с самим извлечением продолжает работать в фоне до завершения —
+// полноценной отмены чтения архива стандартная библиотека не даёт, поэтому
+// таймаут лишь не даёт ей заблокировать пул воркеров.
+func extractFileInfoWithTimeout(archivePath string, timeout time.Duration) ([]FileRecord, error, time.Duration) {
+	start := time.Now()
+
+	type result struct {
+		files []FileRecord
+		err   error
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		files, err := extractFileInfoFromArchive(archivePath)
+		done <- result{files, err}
+	}()
+
+	if timeout <= 0 {
+		r := <-done
+		return r.files, r.err, time.Since(start)
+	}
+
+	select {
+	case r := <-done:
+		return r.files, r.err, time.Since(start)
+	case <-time.After(timeout):
+		return nil, fmt.Errorf("превышен таймаут обработки архива (%s)", timeout), time.Since(start)
+	}
+}
+
+// zipArchiveReader читает записи zip-архивов, используя собственное время
+// модификации каждой записи (f.Modified), а не время модификации архива.
+type zipArchiveReader struct{}
+
+func (zipArchiveReader) Extract(archivePath string) ([]FileRecord, error) {
+	archiveInfo, err := os.Stat(archivePath)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var files []FileRecord
+
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+
+		modTime := f.Modified
+		if modTime.IsZero() {
+			modTime = archiveInfo.ModTime()
+		}
+
+		checksum, err := hashZipEntry(f)
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, FileRecord{
+			Name:        f.Name,
+			ModTime:     modTime,
+			ArchivePath: archivePath,
+			ArchiveName: filepath.Base(archivePath),
+			Size:        int64(f.FileInfo().Size()),
+			Checksum:    checksum,
+		})
+	}
+
+	return files, nil
+}
+
+// hashZipEntry потоково вычисляет SHA-256 содержимого записи zip-архива, не
+// загружая её целиком в память.
+func hashZipEntry(f *zip.File) (string, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, rc); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// tarArchiveReader читает записи tar-архивов (сырых либо сжатых gzip, bzip2
+// или xz), используя per-entry tar.Header.ModTime каждой записи так же, как
+// его заполняет tar.FileInfoHeader при упаковке (Finfo2Theader).
+type tarArchiveReader struct{}
+
+func (tarArchiveReader) Extract(archivePath string) ([]FileRecord, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	src, err := tarDecompressor(archivePath, f)
+	if err != nil {
+		return nil, err
+	}
+
+	tr := tar.NewReader(src)
+
+	var files []FileRecord
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		h := sha256.New()
+		if _, err := io.Copy(h, tr); err != nil {
+			return nil, err
+		}
+
+		files = append(files, FileRecord{
+			Name:        hdr.Name,
+			ModTime:     hdr.ModTime,
+			ArchivePath: archivePath,
+			ArchiveName: filepath.Base(archivePath),
+			Size:        hdr.Size,
+			Checksum:    hex.EncodeToString(h.Sum(nil)),
+		})
+	}
+
+	return files, nil
+}
+
+// tarDecompressor оборачивает содержимое tar-архива подходящим распаковщиком
+// в зависимости от его расширения.
+func tarDecompressor(archivePath string, f *os.File) (io.Reader, error) {
+	lower := strings.ToLower(archivePath)
+
+	switch {
+	case strings.HasSuffix(lower, ".gz"), strings.HasSuffix(lower, ".tgz"):
+		return gzip.NewReader(f)
+	case strings.HasSuffix(lower, ".bz2"), strings.HasSuffix(lower, ".tbz2"):
+		return bzip2.NewReader(f), nil
+	case strings.HasSuffix(lower, ".xz"), strings.HasSuffix(lower, ".txz"):
+		return xz.NewReader(f)
+	default:
+		return f, nil
+	}
+}
+
+// sevenZipArchiveReader читает записи 7z-архивов, используя per-entry время
+// модификации (FileHeader.Modified).
+type sevenZipArchiveReader struct{}
+
+func (sevenZipArchiveReader) Extract(archivePath string) ([]FileRecord, error) {
+	r, err := sevenzip.OpenReader(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var files []FileRecord
+
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+
+		checksum, err := hashSevenZipEntry(f)
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, FileRecord{
+			Name:        f.Name,
+			ModTime:     f.Modified,
+			ArchivePath: archivePath,
+			ArchiveName: filepath.Base(archivePath),
+			Size:        int64(f.UncompressedSize),
+			Checksum:    checksum,
+		})
+	}
+
+	return files, nil
+}
+
+// hashSevenZipEntry потоково вычисляет SHA-256 содержимого записи 7z-архива.
+func hashSevenZipEntry(f *sevenzip.File) (string, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, rc); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// assignVersions заполняет поле Version у каждой записи в allFiles, разбирая
+// версию из имени архива (app-1.2.3.zip) — именно там она почти всегда
+// закодирована, а не в имени записи внутри него, которое часто одно и то же
+// для всех версий (например app.txt). Если ArchiveName версии не содержит,
+// дополнительно пробуем Name. Вынесена из main в отдельную функцию, чтобы
+// выбор стратегии (-strategy semver/hybrid) можно было тестировать вместе с
+// determineLatestReleases без запуска всей программы.
+func assignVersions(allFiles map[string][]FileRecord) {
+	for name, versions := range allFiles {
+		for i := range versions {
+			semver, _, ok := version.ParseVersion(versions[i].ArchiveName)
+			if !ok {
+				semver, _, ok = version.ParseVersion(versions[i].Name)
+			}
+			if ok {
+				versions[i].Version = semver
+			}
+		}
+		allFiles[name] = versions
+	}
+}
+
+// determineLatestReleases определяет последние релизы файлов согласно
+// выбранной стратегии сравнения (strategy: "mtime", "semver" или "hybrid").
+func determineLatestReleases(allFiles map[string][]FileRecord, strategy string) map[string]FileRecord {
+	latest := make(map[string]FileRecord)
+
+	for filename, versions := range allFiles {
+		if len(versions) == 0 {
+			continue
+		}
+
+		// Сортируем версии от старых к новым согласно стратегии
+		sort.Slice(versions, func(i, j int) bool {
+			return releaseLess(versions[i], versions[j], strategy)
+		})
+
+		// Берем последнюю версию (самую новую)
+		latest[filename] = versions[len(versions)-1]
+	}
+
+	return latest
+}
+
+// releaseLess сообщает, что релиз a старше релиза b согласно strategy.
+func releaseLess(a, b FileRecord, strategy string) bool {
+	switch strategy {
+	case "semver":
+		if a.Version == "" && b.Version == "" {
+			return a.ModTime.Before(b.ModTime)
+		}
+		return version.Compare(a.Version, b.Version) < 0
+	case "hybrid":
+		if cmp := version.Compare(a.Version, b.Version); cmp != 0 {
+			return cmp < 0
+		}
+		return a.ModTime.Before(b.ModTime)
+	default: // "mtime"
+		return a.ModTime.Before(b.ModTime)
+	}
+}
+
+// writeFileAtomically записывает содержимое, сформированное write, во
+// временный файл filename+".tmp" и атомарно переименовывает его на место
+// filename (приём из versioner/staggered.go syncthing), чтобы аварийное
+// завершение процесса посреди записи не оставляло после себя усечённый файл.
+func writeFileAtomically(filename string, write func(io.Writer) error) error {
+	tmpFilename := filename + ".tmp"
+
+	file, err := os.Create(tmpFilename)
+	if err != nil {
+		return err
+	}
+
+	if err := write(file); err != nil {
+		file.Close()
+		os.Remove(tmpFilename)
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		os.Remove(tmpFilename)
+		return err
+	}
+
+	return os.Rename(tmpFilename, filename)
+}
+
+// Sink отправляет отчёт об отобранных релизах в конкретном формате: текстовая
+// таблица, JSON, CSV или индекс Elasticsearch. Это позволяет использовать тот
+// же отчёт в CI/наблюдаемости, а не только как фиксированный по ширине текст,
+// который неудобно сравнивать и разбирать программно.
+type Sink interface {
+	Write(results map[string]FileRecord) error
+}
+
+// newSink выбирает реализацию Sink по значению флага -format. Для "elastic"
+// elasticMappingFile, если задан, читается сразу же, чтобы ошибка в пути к
+// файлу маппинга обнаруживалась до начала сканирования, а не в момент записи
+// отчёта.
+func newSink(format, outputFile, elasticURL, elasticIndex, elasticMappingFile string) (Sink, error) {
+	switch format {
+	case "", "text":
+		return TextSink{Filename: outputFile}, nil
+	case "json":
+		return JSONSink{Filename: outputFile}, nil
+	case "csv":
+		return CSVSink{Filename: outputFile}, nil
+	case "elastic":
+		if elasticURL == "" || elasticIndex == "" {
+			return nil, fmt.Errorf("для формата elastic нужно указать -elastic-url и -elastic-index")
+		}
+
+		var mapping string
+		if elasticMappingFile != "" {
+			data, err := os.ReadFile(elasticMappingFile)
+			if err != nil {
+				return nil, fmt.Errorf("чтение файла маппинга индекса Elasticsearch: %w", err)
+			}
+			mapping = string(data)
+		}
+
+		return ElasticSink{URL: elasticURL, Index: elasticIndex, Mapping: mapping}, nil
+	default:
+		return nil, fmt.Errorf("неизвестный формат вывода: %s", format)
+	}
+}
+
+// ReportRecord — сериализуемое представление отобранного релиза для форматов
+// JSON, CSV и Elasticsearch. ReleaseID — производный идентификатор релиза
+// (хеш от имени, даты модификации и архива), пригодный как первичный ключ.
+type ReportRecord struct {
+	Name        string    `json:"name"`
+	ModTime     time.Time `json:"mod_time"`
+	Size        int64     `json:"size"`
+	Version     string    `json:"version,omitempty"`
+	Checksum    string    `json:"checksum,omitempty"`
+	ArchiveName string    `json:"archive_name"`
+	ReleaseID   string    `json:"release_id"`
+}
+
+// toReportRecords преобразует карту отобранных релизов в срез ReportRecord,
+// вычисляя ReleaseID для каждой записи. Записи сортируются по Name, чтобы
+// вывод (JSON/CSV/Elasticsearch) был детерминированным и пригодным для
+// построчного сравнения между запусками — обход map иначе даёт случайный
+// порядок.
+func toReportRecords(results map[string]FileRecord) []ReportRecord {
+	records := make([]ReportRecord, 0, len(results))
+
+	for _, r := range results {
+		records = append(records, ReportRecord{
+			Name:        r.Name,
+			ModTime:     r.ModTime,
+			Size:        r.Size,
+			Version:     r.Version,
+			Checksum:    r.Checksum,
+			ArchiveName: r.ArchiveName,
+			ReleaseID:   releaseID(r),
+		})
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Name < records[j].Name
+	})
+
+	return records
+}
+
+// releaseID вычисляет стабильный идентификатор релиза как SHA-256 от имени,
+// даты модификации и архива-источника.
+func releaseID(r FileRecord) string {
+	h := sha256.New()
+	io.WriteString(h, r.Name)
+	io.WriteString(h, r.ModTime.Format(time.RFC3339Nano))
+	io.WriteString(h, r.ArchiveName)
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// TextSink записывает результаты в виде таблицы фиксированной ширины,
+// изначальный и по умолчанию используемый формат отчёта.
+type TextSink struct {
+	Filename string
+}
+
+func (s TextSink) Write(results map[string]FileRecord) error {
+	return writeFileAtomically(s.Filename, func(w io.Writer) error {
+		// Записываем заголовок
+		header := fmt.Sprintf("%-50s %-20s %-10s %-15s %s\n", "Файл", "Дата релиза", "Размер", "Версия", "Архив")
+		divider := strings.Repeat("-", len(header)) + "\n"
+
+		if _, err := io.WriteString(w, header); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, divider); err != nil {
+			return err
+		}
+
+		// Записываем данные в порядке, отсортированном по имени файла, чтобы
+		// отчёт был детерминированным и его можно было построчно сравнивать
+		// между запусками
+		for _, record := range toReportRecords(results) {
+			versionColumn := record.Version
+			if versionColumn == "" {
+				versionColumn = "-"
+			}
+
+			line := fmt.Sprintf("%-50s %-20s %-10d %-15s %s\n",
+				truncateString(record.Name, 50),
+				record.ModTime.Format("2006-01-02 15:04:05"),
+				record.Size,
+				versionColumn,
+				record.ArchiveName)
+
+			if _, err := io.WriteString(w, line); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// JSONSink записывает результаты как JSON-массив ReportRecord.
+type JSONSink struct {
+	Filename string
+}
+
+func (s JSONSink) Write(results map[string]FileRecord) error {
+	return writeFileAtomically(s.Filename, func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(toReportRecords(results))
+	})
+}
+
+// CSVSink записывает результаты как CSV-таблицу ReportRecord.
+type CSVSink struct {
+	Filename string
+}
+
+func (s CSVSink) Write(results map[string]FileRecord) error {
+	return writeFileAtomically(s.Filename, func(w io.Writer) error {
+		cw := csv.NewWriter(w)
+
+		header := []string{"name", "mod_time", "size", "version", "checksum", "archive_name", "release_id"}
+		if err := cw.Write(header); err != nil {
+			return err
+		}
+
+		for _, record := range toReportRecords(results) {
+			row := []string{
+				record.Name,
+				record.ModTime.Format(time.RFC3339),
+				strconv.FormatInt(record.Size, 10),
+				record.Version,
+				record.Checksum,
+				record.ArchiveName,
+				record.ReleaseID,
+			}
+			if err := cw.Write(row); err != nil {
+				return err
+			}
+		}
+
+		cw.Flush()
+		return cw.Error()
+	})
+}
+
+// ElasticSink индексирует результаты в Elasticsearch через bulk API
+// (POST {URL}/_bulk), по одной паре action/record на каждый релиз. Если
+// Mapping задан, индекс перед первой отправкой создаётся с этим маппингом
+// (см. ensureIndex) — если он уже существует, Mapping игнорируется.
+type ElasticSink struct {
+	URL     string
+	Index   string
+	Mapping string
+}
+
+// ensureIndex создаёт индекс Elasticsearch с маппингом s.Mapping, если он
+// ещё не существует. Вызывается перед первой bulk-отправкой, только когда
+// Mapping непуст — Write не должен требовать маппинг для уже существующих
+// индексов.
+func (s ElasticSink) ensureIndex() error {
+	indexURL := strings.TrimRight(s.URL, "/") + "/" + s.Index
+
+	head, err := http.Head(indexURL)
+	if err != nil {
+		return fmt.Errorf("проверка существования индекса Elasticsearch: %w", err)
+	}
+	head.Body.Close()
+	if head.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	req, err := http.NewRequest(http.MethodPut, indexURL, strings.NewReader(s.Mapping))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("создание индекса Elasticsearch с маппингом: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("Elasticsearch вернул статус %s при создании индекса %s", resp.Status, s.Index)
+	}
+
+	return nil
+}
+
+func (s ElasticSink) Write(results map[string]FileRecord) error {
+	if s.Mapping != "" {
+		if err := s.ensureIndex(); err != nil {
+			return err
+		}
+	}
+
+	var buf bytes.Buffer
+
+	enc := json.NewEncoder(&buf)
+	for _, record := range toReportRecords(results) {
+		action := map[string]map[string]string{
+			"index": {"_index": s.Index, "_id": record.ReleaseID},
+		}
+
+		if err := enc.Encode(action); err != nil {
+			return err
+		}
+		if err := enc.Encode(record); err != nil {
+			return err
+		}
+	}
+
+	bulkURL := strings.TrimRight(s.URL, "/") + "/_bulk"
+
+	resp, err := http.Post(bulkURL, "application/x-ndjson", &buf)
+	if err != nil {
+		return fmt.Errorf("отправка bulk-запроса в Elasticsearch: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("Elasticsearch вернул статус %s", resp.Status)
+	}
+
+	return nil
+}
+
+// writeChecksumManifest записывает манифест контрольных сумм отобранных
+// релизов: SHA-256, размер, дату модификации и архив-источник каждого файла.
+// SHA-256 берётся из FileRecord.Checksum, посчитанного потоково во время
+// извлечения, так что манифест даёт проверяемый индекс артефактов без
+// повторного чтения архивов. Записи сортируются по имени через
+// toReportRecords, чтобы манифест был детерминированным и пригодным для
+// построчного сравнения между запусками.
+func writeChecksumManifest(filename string, results map[string]FileRecord) error {
+	records := toReportRecords(results)
+
+	return writeFileAtomically(filename, func(w io.Writer) error {
+		for _, record := range records {
+			line := fmt.Sprintf("%s  %s  %d  %s  %s\n",
+				record.Checksum,
+				record.Name,
+				record.Size,
+				record.ModTime.Format(time.RFC3339),
+				record.ArchiveName)
+
+			if _, err := io.WriteString(w, line); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// truncateString обрезает строку до указанной длины
+func truncateString(s string, maxLen int) string {
+	if len(s) <= maxLen {
+		return s
+	}
+	return s[:maxLen-3] + "..."
+}
+
+// runPrune применяет retention.DefaultPolicy к копиям каждого файла, кроме
+// той, что определена как последний релиз в latestReleases (её удалять
+// нельзя никогда), и удаляет архивы отобранных на удаление копий. Без -apply
+// только печатает, что было бы удалено. Поскольку одну запись внутри архива
+// нельзя удалить, не переписав архив целиком, решение о сохранении
+// принимается на уровне архива: если нужна точечная очистка записей внутри
+// ещё актуального архива, извлеките его содержимое в отдельную директорию и
+// запускайте -prune уже по ней.
+//
+// Один архив может содержать записи для нескольких разных имён файлов, и
+// быть последним релизом для одного имени, но нести устаревшую копию
+// другого. Поэтому protectedArchives строится из ArchivePath *всех* записей
+// latestReleases сразу, а не только текущего name — иначе удаление архива
+// ради устаревшей копии X могло бы стереть единственную актуальную копию Y,
+// живущую в том же архиве.
+func runPrune(allFiles map[string][]FileRecord, latestReleases map[string]FileRecord, apply bool) {
+	policy := retention.DefaultPolicy()
+
+	protectedArchives := make(map[string]bool, len(latestReleases))
+	for _, latest := range latestReleases {
+		protectedArchives[latest.ArchivePath] = true
+	}
+
+	var kept, dropped int
+
+	for name, versions := range allFiles {
+		latest := latestReleases[name]
+
+		var candidates []retention.FileRecord
+		for _, v := range versions {
+			if v.ArchivePath == latest.ArchivePath {
+				continue // это и есть текущий последний релиз name
+			}
+			candidates = append(candidates, toRetentionRecord(v))
+		}
+
+		if len(candidates) == 0 {
+			continue
+		}
+
+		keep, drop := policy.Select(candidates)
+		kept += len(keep)
+
+		for _, d := range drop {
+			if protectedArchives[d.ArchivePath] {
+				// Архив d.ArchivePath — последний релиз какого-то другого
+				// файла; удалять его целиком нельзя.
+				kept++
+				continue
+			}
+
+			dropped++
+
+			if apply {
+				if err := os.Remove(d.ArchivePath); err != nil {
+					log.Printf("Ошибка удаления %s: %v", d.ArchivePath, err)
+					continue
+				}
+				fmt.Printf("Удалено: %s (%s)\n", d.Name, d.ArchivePath)
+			} else {
+				fmt.Printf("[dry-run] Было бы удалено: %s (%s)\n", d.Name, d.ArchivePath)
+			}
+		}
+	}
+
+	fmt.Printf("Оставлено копий: %d, удалено (или было бы удалено): %d\n", kept, dropped)
+}
+
+// toRetentionRecord конвертирует FileRecord в упрощённый retention.FileRecord,
+// которым оперирует пакет retention.
+func toRetentionRecord(r FileRecord) retention.FileRecord {
+	return retention.FileRecord{
+		Name:        r.Name,
+		ModTime:     r.ModTime,
+		ArchivePath: r.ArchivePath,
+		ArchiveName: r.ArchiveName,
+		Size:        r.Size,
+	}
+}
+
+// printScanProgress печатает строку прогресс-бара (по доле обработанных
+// байт архивов) после обработки каждого архива.
+func printScanProgress(p ScanProgress) {
+	percent := 100.0
+	if p.BytesTotal > 0 {
+		percent = float64(p.BytesDone) / float64(p.BytesTotal) * 100
+	}
+
+	status := "ok"
+	if p.Err != nil {
+		status = "ошибка"
+	}
+
+	fmt.Printf("[%5.1f%%] (%d/%d) %s за %s — %s\n",
+		percent, p.ArchivesDone, p.ArchivesTotal, p.ArchivePath, p.Duration.Round(time.Millisecond), status)
+}
+
+// printScanSummary печатает итоговое время обработки каждого архива.
+func printScanSummary(report *ScanReport) {
+	fmt.Println("Время обработки архивов:")
+
+	for path, d := range report.Timings {
+		fmt.Printf("  %s: %s\n", path, d.Round(time.Millisecond))
+	}
+}
+
+func main() {
+	flag.Parse()
+
+	// Конфигурационные параметры
+	archiveDir := "X:/NETDBS"                  // Директория с архивами
+	outputFile := "./latest_releases.txt"      // Файл для записи результатов
+	manifestFile := "./latest_releases.sha256" // Манифест контрольных сумм отобранных релизов
+
+	fmt.Printf("Поиск архивов в директории: %s\n", archiveDir)
+
+	// Сканируем архивы пулом воркеров, печатая прогресс по мере обработки
+	report, err := Scan(archiveDir, ScanOptions{
+		Jobs:           *scanJobs,
+		ArchiveTimeout: *archiveTimeout,
+		Progress:       printScanProgress,
+	})
+	if err != nil {
+		log.Fatalf("Ошибка сканирования архивов: %v", err)
+	}
+
+	if len(report.Timings) == 0 {
+		log.Fatal("Архивы не найдены")
+	}
+
+	fmt.Printf("Найдено архивов: %d\n", len(report.Timings))
+
+	for _, archErr := range report.Errors {
+		log.Printf("Ошибка обработки архива %s: %v", archErr.ArchivePath, archErr.Err)
+	}
+
+	// Определяем версию каждого файла
+	allFiles := report.Files
+	assignVersions(allFiles)
+
+	printScanSummary(report)
+
+	// Определяем последние релизы файлов
+	latestReleases := determineLatestReleases(allFiles, *releaseStrategy)
+
+	if *pruneMode {
+		runPrune(allFiles, latestReleases, *applyPrune)
+		return
+	}
+
+	// Сохраняем результаты в выбранном формате
+	sink, err := newSink(*outputFormat, outputFile, *elasticURL, *elasticIndex, *elasticMapping)
+	if err != nil {
+		log.Fatalf("Ошибка выбора формата вывода: %v", err)
+	}
+
+	if err := sink.Write(latestReleases); err != nil {
+		log.Fatalf("Ошибка записи результатов: %v", err)
+	}
+
+	// Сохраняем манифест контрольных сумм отобранных релизов
+	err = writeChecksumManifest(manifestFile, latestReleases)
+	if err != nil {
+		log.Fatalf("Ошибка записи манифеста контрольных сумм: %v", err)
+	}
+
+	fmt.Printf("Результаты сохранены в файл: %s\n", outputFile)
+	fmt.Printf("Манифест контрольных сумм сохранён в файл: %s\n", manifestFile)
+	fmt.Printf("Обработано уникальных файлов: %d\n", len(latestReleases))
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestZip создаёт в dir zip-архив name с одной записью entryName и
+// заданным содержимым/временем модификации — минимальная фикстура,
+// достаточная для Scan.
+func writeTestZip(t *testing.T, dir, name, entryName, content string, modTime time.Time) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("os.Create(%s): %v", path, err)
+	}
+	defer f.Close()
+
+	w := zip.NewWriter(f)
+	hdr := &zip.FileHeader{Name: entryName, Method: zip.Deflate}
+	hdr.Modified = modTime
+	entry, err := w.CreateHeader(hdr)
+	if err != nil {
+		t.Fatalf("CreateHeader(%s): %v", entryName, err)
+	}
+	if _, err := entry.Write([]byte(content)); err != nil {
+		t.Fatalf("Write(%s): %v", entryName, err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("zip.Writer.Close: %v", err)
+	}
+
+	return path
+}
+
+func TestScanFindsFilesAcrossArchives(t *testing.T) {
+	dir := t.TempDir()
+
+	older := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	writeTestZip(t, dir, "app-1.0.0.zip", "app.txt", "v1", older)
+	writeTestZip(t, dir, "app-2.0.0.zip", "app.txt", "v2", newer)
+
+	report, err := Scan(dir, ScanOptions{Jobs: 2})
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+
+	if len(report.Errors) != 0 {
+		t.Fatalf("expected no archive errors, got %v", report.Errors)
+	}
+
+	records, ok := report.Files["app.txt"]
+	if !ok {
+		t.Fatalf("expected app.txt in report.Files, got %v", report.Files)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records for app.txt, got %d", len(records))
+	}
+
+	var sawOlder, sawNewer bool
+	for _, r := range records {
+		if r.ArchiveName == "app-1.0.0.zip" && r.ModTime.Equal(older) {
+			sawOlder = true
+		}
+		if r.ArchiveName == "app-2.0.0.zip" && r.ModTime.Equal(newer) {
+			sawNewer = true
+		}
+		if r.Checksum == "" {
+			t.Errorf("expected non-empty Checksum for %s", r.ArchiveName)
+		}
+	}
+	if !sawOlder || !sawNewer {
+		t.Errorf("expected records from both archives, got %v", records)
+	}
+}
+
+func TestDetermineLatestReleasesSemverStrategyUsesArchiveName(t *testing.T) {
+	dir := t.TempDir()
+
+	// app-2.0.0.zip имеет более старую mtime, но более высокую версию —
+	// со стратегией semver он должен победить, несмотря на mtime;
+	// каждая запись внутри архива называется одинаково (app.txt), как в
+	// типичном случае версионированного архива с неизменным именем файла
+	// внутри.
+	older := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	newer := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	writeTestZip(t, dir, "app-2.0.0.zip", "app.txt", "v2", newer)
+	writeTestZip(t, dir, "app-1.0.0.zip", "app.txt", "v1", older)
+
+	report, err := Scan(dir, ScanOptions{Jobs: 2})
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+
+	allFiles := report.Files
+	assignVersions(allFiles)
+
+	latest := determineLatestReleases(allFiles, "semver")
+	got := latest["app.txt"]
+	if got.ArchiveName != "app-2.0.0.zip" {
+		t.Errorf("strategy semver: expected latest release from app-2.0.0.zip, got %s", got.ArchiveName)
+	}
+
+	// Контрольная проверка: со стратегией mtime побеждает app-1.0.0.zip,
+	// подтверждая, что разница в результате действительно вызвана
+	// версией, а не случайностью выбора архива.
+	latestMtime := determineLatestReleases(allFiles, "mtime")
+	gotMtime := latestMtime["app.txt"]
+	if gotMtime.ArchiveName != "app-1.0.0.zip" {
+		t.Errorf("strategy mtime: expected latest release from app-1.0.0.zip, got %s", gotMtime.ArchiveName)
+	}
+}
+
+func TestScanReportsErrorForCorruptArchive(t *testing.T) {
+	dir := t.TempDir()
+
+	bad := filepath.Join(dir, "broken.zip")
+	if err := os.WriteFile(bad, []byte("not a zip"), 0o644); err != nil {
+		t.Fatalf("os.WriteFile: %v", err)
+	}
+
+	report, err := Scan(dir, ScanOptions{Jobs: 1})
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+
+	if len(report.Errors) != 1 {
+		t.Fatalf("expected 1 archive error, got %v", report.Errors)
+	}
+	if report.Errors[0].ArchivePath != bad {
+		t.Errorf("expected error for %s, got %s", bad, report.Errors[0].ArchivePath)
+	}
+}
@@ -0,0 +1,101 @@
+// Package retention реализует ступенчатую (staggered) политику хранения
+// версий файлов, аналогичную versioner/staggered.go из syncthing: чем старше
+// версия, тем реже среди её копий сохраняется хотя бы одна.
+package retention
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// FileRecord — минимальное описание одной копии файла, достаточное для
+// применения политики хранения: имя, путь к архиву-источнику и дата
+// модификации.
+type FileRecord struct {
+	Name        string
+	ModTime     time.Time
+	ArchivePath string
+	ArchiveName string
+	Size        int64
+}
+
+// Interval описывает один уровень политики: в пределах возраста [0, End)
+// сохраняется не более одной версии на каждые Step времени. End == 0 значит
+// "без верхней границы" — это должен быть последний интервал в Policy.
+type Interval struct {
+	Step time.Duration
+	End  time.Duration
+}
+
+// Policy — упорядоченный по возрастанию возраста набор интервалов хранения.
+type Policy struct {
+	Intervals []Interval
+}
+
+// DefaultPolicy возвращает политику: по одной версии в час за последние 24
+// часа, по одной в день за последние 30 дней, по одной в неделю за последний
+// год и по одной в месяц после этого.
+func DefaultPolicy() Policy {
+	day := 24 * time.Hour
+
+	return Policy{Intervals: []Interval{
+		{Step: time.Hour, End: day},
+		{Step: day, End: 30 * day},
+		{Step: 7 * day, End: 365 * day},
+		{Step: 30 * day, End: 0},
+	}}
+}
+
+// Select сортирует versions по дате модификации (от новых к старым) и
+// относит каждую к интервалу, соответствующему её возрасту относительно
+// текущего момента, оставляя только самую новую версию на каждый шаг
+// интервала. Версии, возраст которых не покрыт ни одним интервалом (End == 0
+// отсутствует в Policy), возвращаются в drop.
+func (p Policy) Select(versions []FileRecord) (keep, drop []FileRecord) {
+	return p.selectAt(versions, time.Now())
+}
+
+// selectAt — как Select, но с явно заданным "текущим" моментом; вынесено
+// отдельно, чтобы поведение политики можно было проверить детерминированно.
+func (p Policy) selectAt(versions []FileRecord, now time.Time) (keep, drop []FileRecord) {
+	sorted := append([]FileRecord(nil), versions...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].ModTime.After(sorted[j].ModTime)
+	})
+
+	seenBuckets := make(map[string]bool, len(sorted))
+
+	for _, v := range sorted {
+		age := now.Sub(v.ModTime)
+
+		interval, ok := p.intervalFor(age)
+		if !ok {
+			drop = append(drop, v)
+			continue
+		}
+
+		bucket := fmt.Sprintf("%d:%d", interval.Step, age/interval.Step)
+		if seenBuckets[bucket] {
+			drop = append(drop, v)
+			continue
+		}
+
+		seenBuckets[bucket] = true
+		keep = append(keep, v)
+	}
+
+	return keep, drop
+}
+
+// intervalFor возвращает первый интервал, чья верхняя граница покрывает age
+// (End == 0 трактуется как "без ограничения").
+func (p Policy) intervalFor(age time.Duration) (Interval, bool) {
+	for _, iv := range p.Intervals {
+		if iv.End == 0 || age < iv.End {
+			return iv, true
+		}
+	}
+
+	return Interval{}, false
+}
@@ -0,0 +1,73 @@
+package retention
+
+import (
+	"testing"
+	"time"
+)
+
+func rec(name string, age time.Duration, now time.Time) FileRecord {
+	return FileRecord{Name: name, ModTime: now.Add(-age)}
+}
+
+func TestPolicySelectAt(t *testing.T) {
+	now := time.Date(2026, 7, 27, 0, 0, 0, 0, time.UTC)
+	policy := DefaultPolicy()
+
+	versions := []FileRecord{
+		rec("h0", 10*time.Minute, now),     // same hour bucket as h1
+		rec("h1", 40*time.Minute, now),     // dropped, same bucket as h0
+		rec("h2", 3*time.Hour, now),        // different hour bucket, kept
+		rec("d0", 2*24*time.Hour, now),     // within 30d window, own day bucket
+		rec("old1", 400*24*time.Hour, now), // beyond 365d, same month bucket as old2
+		rec("old2", 405*24*time.Hour, now), // older duplicate of old1's month bucket
+	}
+
+	keep, drop := policy.selectAt(versions, now)
+
+	keptNames := map[string]bool{}
+	for _, v := range keep {
+		keptNames[v.Name] = true
+	}
+	droppedNames := map[string]bool{}
+	for _, v := range drop {
+		droppedNames[v.Name] = true
+	}
+
+	if !keptNames["h0"] || droppedNames["h0"] {
+		t.Errorf("expected h0 (newest in its bucket) to be kept")
+	}
+	if !droppedNames["h1"] {
+		t.Errorf("expected h1 (older duplicate of h0's bucket) to be dropped")
+	}
+	if !keptNames["h2"] {
+		t.Errorf("expected h2 (its own hour bucket) to be kept")
+	}
+	if !keptNames["d0"] {
+		t.Errorf("expected d0 (its own day bucket) to be kept")
+	}
+	if !keptNames["old1"] || droppedNames["old1"] {
+		t.Errorf("expected old1 (newer of the two beyond-365d copies) to be kept")
+	}
+	if !droppedNames["old2"] {
+		t.Errorf("expected old2 (older duplicate of old1's month bucket) to be dropped")
+	}
+}
+
+func TestPolicySelectAtBoundaryAge(t *testing.T) {
+	now := time.Date(2026, 7, 27, 0, 0, 0, 0, time.UTC)
+	policy := Policy{Intervals: []Interval{{Step: time.Hour, End: time.Hour}}}
+
+	versions := []FileRecord{
+		rec("within", 59*time.Minute, now),
+		rec("beyond", time.Hour, now), // age == End is NOT covered ([0, End))
+	}
+
+	keep, drop := policy.selectAt(versions, now)
+
+	if len(keep) != 1 || keep[0].Name != "within" {
+		t.Errorf("expected only 'within' to be kept, got keep=%v", keep)
+	}
+	if len(drop) != 1 || drop[0].Name != "beyond" {
+		t.Errorf("expected 'beyond' to be dropped as uncovered by any interval, got drop=%v", drop)
+	}
+}
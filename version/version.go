@@ -0,0 +1,155 @@
+// Package version извлекает и сравнивает номера версий, зашитые в имена
+// файлов и архивов (например "name-1.2.3.zip" или "name-20230126.zip"),
+// чтобы определять порядок релизов без опоры на mtime файловой системы,
+// который легко искажается копированием/rsync.
+package version
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// Группа 1 — числовые компоненты версии, группа 2 — необязательный
+	// пре-релизный суффикс (например "-rc1" или ".beta.2").
+	semverTokenRe = regexp.MustCompile(`^v?(\d+(?:\.\d+){0,3})((?:[-.][0-9A-Za-z]+)*)$`)
+	dateTokenRe   = regexp.MustCompile(`^(\d{4})(\d{2})(\d{2})$`)
+)
+
+// ParseVersion ищет номер версии в имени файла или архива. Расширение
+// отбрасывается, остаток разбивается на группы по "_" и " ", а каждая
+// группа, целиком или после дополнительного разбиения по "-", проверяется
+// сначала на восьмизначную дату (YYYYMMDD), затем на шаблон семантической
+// версии `v?N(.N){0,3}(-pre)*`. semver — канонический вид найденной версии
+// ("N.N.N" или "N.N.N-pre"), пригодный для сравнения функцией Compare; tag —
+// исходный фрагмент имени, из которого версия была извлечена. ok=false
+// означает, что версию извлечь не удалось и вызывающему коду следует
+// использовать mtime.
+func ParseVersion(name string) (semver, tag string, ok bool) {
+	base := stripExt(name)
+
+	groups := strings.FieldsFunc(base, func(r rune) bool {
+		return r == '_' || r == ' '
+	})
+
+	for _, group := range groups {
+		if semver, tag, ok := matchToken(group); ok {
+			return semver, tag, ok
+		}
+
+		for _, sub := range strings.Split(group, "-") {
+			if semver, tag, ok := matchToken(sub); ok {
+				return semver, tag, ok
+			}
+		}
+	}
+
+	return "", "", false
+}
+
+// stripExt отбрасывает расширение имени файла, включая один уровень
+// дополнительного сжатия у tar-архивов (например ".tar.gz" целиком),
+// чтобы оно не мешало распознаванию версии.
+func stripExt(name string) string {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+
+	switch strings.ToLower(ext) {
+	case ".gz", ".bz2", ".xz":
+		if inner := filepath.Ext(base); strings.ToLower(inner) == ".tar" {
+			base = strings.TrimSuffix(base, inner)
+		}
+	}
+
+	return base
+}
+
+// matchToken проверяет один токен на соответствие восьмизначной дате или
+// шаблону версии. Дата проверяется первой, иначе "20230126" распознавался
+// бы семверной проверкой как версия "20230126" без разделителей.
+func matchToken(token string) (semver, tag string, ok bool) {
+	if token == "" {
+		return "", "", false
+	}
+
+	if m := dateTokenRe.FindStringSubmatch(token); m != nil {
+		return fmt.Sprintf("%s.%s.%s", m[1], m[2], m[3]), token, true
+	}
+
+	if m := semverTokenRe.FindStringSubmatch(token); m != nil {
+		numPart, pre := m[1], m[2]
+
+		canon := numPart
+		if pre != "" {
+			canon += "-" + strings.Trim(pre, "-.")
+		}
+
+		return canon, token, true
+	}
+
+	return "", "", false
+}
+
+// Compare сравнивает две версии в каноническом виде, возвращаемом
+// ParseVersion, и возвращает отрицательное число, если a старше b,
+// положительное, если a новее, и 0 при равенстве. Числовые компоненты
+// сравниваются численно; версия с пре-релизным суффиксом (-rc, -beta,
+// -alpha, ...) считается старше соответствующей версии без суффикса.
+func Compare(a, b string) int {
+	aNums, aPre := splitSuffix(a)
+	bNums, bPre := splitSuffix(b)
+
+	aParts := numericParts(aNums)
+	bParts := numericParts(bNums)
+
+	for i := 0; i < len(aParts) || i < len(bParts); i++ {
+		var av, bv int
+		if i < len(aParts) {
+			av = aParts[i]
+		}
+		if i < len(bParts) {
+			bv = bParts[i]
+		}
+		if av != bv {
+			return av - bv
+		}
+	}
+
+	switch {
+	case aPre == bPre:
+		return 0
+	case aPre == "":
+		return 1
+	case bPre == "":
+		return -1
+	default:
+		return strings.Compare(aPre, bPre)
+	}
+}
+
+// splitSuffix отделяет числовой префикс канонической версии от
+// пре-релизного суффикса, добавленного ParseVersion через дефис.
+func splitSuffix(canon string) (numPart, pre string) {
+	if idx := strings.IndexByte(canon, '-'); idx != -1 {
+		return canon[:idx], canon[idx+1:]
+	}
+	return canon, ""
+}
+
+func numericParts(s string) []int {
+	fields := strings.Split(s, ".")
+
+	nums := make([]int, 0, len(fields))
+	for _, f := range fields {
+		n, err := strconv.Atoi(f)
+		if err != nil {
+			continue
+		}
+		nums = append(nums, n)
+	}
+
+	return nums
+}
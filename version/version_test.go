@@ -0,0 +1,50 @@
+package version
+
+import "testing"
+
+func TestParseVersion(t *testing.T) {
+	cases := []struct {
+		name       string
+		wantSemver string
+		wantTag    string
+		wantOK     bool
+	}{
+		{"app-1.2.3.zip", "1.2.3", "1.2.3", true},
+		{"app_v1.2.3-rc1.zip", "1.2.3-rc1", "v1.2.3-rc1", true},
+		{"app-20230126.zip", "2023.01.26", "20230126", true},
+		{"app-1.2.3.tar.gz", "1.2.3", "1.2.3", true},
+		{"app-v2.tar.gz", "2", "v2", true},
+		{"app.zip", "", "", false},
+		{"readme.txt", "", "", false},
+	}
+
+	for _, c := range cases {
+		semver, tag, ok := ParseVersion(c.name)
+		if ok != c.wantOK || semver != c.wantSemver || tag != c.wantTag {
+			t.Errorf("ParseVersion(%q) = (%q, %q, %v), want (%q, %q, %v)",
+				c.name, semver, tag, ok, c.wantSemver, c.wantTag, c.wantOK)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"1.2.3", "1.2.4", -1},
+		{"1.2.4", "1.2.3", 1},
+		{"1.2.3", "1.2.3", 0},
+		{"1.2.3-rc1", "1.2.3", -1},
+		{"1.2.3", "1.2.3-rc1", 1},
+		{"1.10.0", "1.9.0", 1},
+		{"2023.01.26", "2023.01.25", 1},
+	}
+
+	for _, c := range cases {
+		got := Compare(c.a, c.b)
+		if (got < 0 && c.want >= 0) || (got > 0 && c.want <= 0) || (got == 0 && c.want != 0) {
+			t.Errorf("Compare(%q, %q) = %d, want sign %d", c.a, c.b, got, c.want)
+		}
+	}
+}